@@ -0,0 +1,58 @@
+package log
+
+import (
+	"os"
+	"testing"
+)
+
+func benchStore(b *testing.B) *store {
+	b.Helper()
+	f, err := os.CreateTemp("", "store_bench")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() {
+		f.Close()
+		os.Remove(f.Name())
+	})
+	s, err := newStore(f)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return s
+}
+
+func BenchmarkStoreRead(b *testing.B) {
+	s := benchStore(b)
+	write := []byte("the quick brown fox jumps over the lazy dog")
+	_, pos, err := s.Append(write)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := s.Read(pos); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkStoreReadInto(b *testing.B) {
+	s := benchStore(b)
+	write := []byte("the quick brown fox jumps over the lazy dog")
+	_, pos, err := s.Append(write)
+	if err != nil {
+		b.Fatal(err)
+	}
+	dst := make([]byte, len(write))
+
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := s.ReadInto(pos, dst); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package log
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStoreReadDetectsCorruption(t *testing.T) {
+	s, name := newTestStore(t)
+	want := []byte("hello, distributed services")
+
+	_, pos, err := s.Append(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = reopenTestStore(t, s, name)
+
+	// Flip a byte inside the record's data, bypassing the store entirely,
+	// to simulate bitrot on disk.
+	raw, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	corruptOff := int64(pos) + lenWidth + crcWidth
+	if _, err := raw.WriteAt([]byte{want[0] ^ 0xff}, corruptOff); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Read(pos); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("Read: want ErrCorrupt, got %v", err)
+	}
+}
+
+func TestStoreReadRoundTripsGoodRecord(t *testing.T) {
+	s, _ := newTestStore(t)
+	want := []byte("no corruption here")
+
+	_, pos, err := s.Append(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.Read(pos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Fatalf("Read: got %q, want %q", got, want)
+	}
+}
+
+func TestStoreVerifyReportsCorruptOffsets(t *testing.T) {
+	s, name := newTestStore(t)
+
+	var positions []uint64
+	for _, rec := range []string{"one", "two", "three"} {
+		_, pos, err := s.Append([]byte(rec))
+		if err != nil {
+			t.Fatal(err)
+		}
+		positions = append(positions, pos)
+	}
+	s = reopenTestStore(t, s, name)
+
+	raw, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	corruptPos := positions[1]
+	if _, err := raw.WriteAt([]byte{0x00}, int64(corruptPos)+lenWidth+crcWidth); err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.Verify(context.Background())
+	if !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("Verify: want ErrCorrupt, got %v", err)
+	}
+	if want := fmt.Sprintf("offsets [%d]", corruptPos); !strings.Contains(err.Error(), want) {
+		t.Fatalf("Verify: want error reporting %q, got %v", want, err)
+	}
+}
+
+func TestStoreScrubReportsCorruptOffset(t *testing.T) {
+	s, name := newTestStore(t)
+
+	_, pos, err := s.Append([]byte("scrub me"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = reopenTestStore(t, s, name)
+
+	raw, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	if _, err := raw.WriteAt([]byte{0xff}, int64(pos)+lenWidth+crcWidth); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	corrupt := s.Scrub(ctx, 5*time.Millisecond)
+
+	select {
+	case got, ok := <-corrupt:
+		if !ok {
+			t.Fatal("Scrub: channel closed before reporting the corrupt offset")
+		}
+		if got != pos {
+			t.Fatalf("Scrub: got offset %d, want %d", got, pos)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Scrub: timed out waiting for the corrupt offset")
+	}
+}
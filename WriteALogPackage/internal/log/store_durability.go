@@ -0,0 +1,182 @@
+package log
+
+import (
+	"errors"
+	"time"
+)
+
+// errStoreClosed is returned by a durability call that loses a race with
+// Close: the store's buffered writer has already been reset and handed
+// back to the shared pool, so there's nothing left to flush or sync.
+var errStoreClosed = errors.New("log: store closed")
+
+// SyncPolicy controls when a store's buffered writes become durable.
+type SyncPolicy int
+
+const (
+	// SyncNone leaves durability entirely up to the caller: Append never
+	// syncs on its own, and AppendSync performs a one-off flush+Sync for
+	// just that call.
+	SyncNone SyncPolicy = iota
+	// SyncInterval runs a background committer that coalesces concurrent
+	// appends into a single flush+Sync, woken by either a fixed interval
+	// or a byte threshold. AppendSync blocks until the committer has
+	// covered its record.
+	SyncInterval
+	// SyncEveryWrite flushes and syncs on every single Append, trading
+	// throughput for the strongest guarantee: Append itself never
+	// returns before the record is durable.
+	SyncEveryWrite
+)
+
+const (
+	// syncInterval is how often the SyncInterval committer wakes up on
+	// its own, absent a byte-threshold kick.
+	syncInterval = time.Millisecond
+	// syncByteThreshold is how many bytes of unsynced appends accumulate
+	// before the SyncInterval committer is kicked early.
+	syncByteThreshold = 64 * 1024
+)
+
+// WithSyncPolicy sets how the store's Append/AppendSync durability works.
+// The default, if this option isn't supplied, is SyncNone.
+func WithSyncPolicy(policy SyncPolicy) storeOption {
+	return func(s *store) {
+		s.syncPolicy = policy
+	}
+}
+
+// syncWaiter is a pending AppendSync call: done receives the commit error
+// (or nil) once every byte up to pos has been flushed and synced.
+type syncWaiter struct {
+	pos  uint64
+	done chan error
+}
+
+// AppendSync appends p exactly like Append, but doesn't return until the
+// record is durable on disk. Under SyncEveryWrite it flushes and syncs
+// immediately; under SyncInterval it waits for the background committer
+// to catch up; under SyncNone (the default) it performs that same
+// flush+Sync itself, since no committer is running to do it.
+func (s *store) AppendSync(p []byte) (n uint64, pos uint64, err error) {
+	n, pos, err = s.Append(p)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if s.syncPolicy == SyncEveryWrite {
+		return n, pos, s.flushAndSync()
+	}
+
+	if s.syncPolicy == SyncNone {
+		// No committer is running under this policy, so AppendSync has
+		// to drive its own flush+Sync to keep its durability promise.
+		return n, pos, s.flushAndSync()
+	}
+
+	// SyncInterval: register as a waiter and let the background committer
+	// catch us up. stopped and waiters share waitersMu, so this check and
+	// the registration below are atomic with Close's own critical
+	// section — we either see stopped before Close sets it (and get
+	// serviced by Close's final commit) or after (and fall back to
+	// syncing ourselves, since nothing will wake us otherwise).
+	durableAt := pos + n
+	done := make(chan error, 1)
+	s.waitersMu.Lock()
+	if s.stopped {
+		s.waitersMu.Unlock()
+		return n, pos, s.flushAndSync()
+	}
+	s.waiters = append(s.waiters, syncWaiter{pos: durableAt, done: done})
+	s.waitersMu.Unlock()
+
+	s.kickCommitter()
+	return n, pos, <-done
+}
+
+// flushAndSync flushes the buffered writer and fsyncs the file, returning
+// whichever error came first. Used wherever a caller needs a durability
+// guarantee without going through the waiter/committer machinery.
+func (s *store) flushAndSync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errStoreClosed
+	}
+	err := s.buf.Flush()
+	if err == nil {
+		err = s.File.Sync()
+	}
+	return err
+}
+
+// maybeKickCommitter wakes the SyncInterval committer early once enough
+// unsynced bytes have piled up, instead of waiting out the full interval.
+// It's a no-op under any other policy.
+func (s *store) maybeKickCommitter(written uint64) {
+	if s.syncPolicy != SyncInterval {
+		return
+	}
+	s.bytesSinceCommit += written
+	if s.bytesSinceCommit >= syncByteThreshold {
+		s.bytesSinceCommit = 0
+		s.kickCommitter()
+	}
+}
+
+// kickCommitter nudges the committer goroutine to run immediately rather
+// than waiting for its next tick. It never blocks: a commit is already
+// pending if the channel's full.
+func (s *store) kickCommitter() {
+	select {
+	case s.kick <- struct{}{}:
+	default:
+	}
+}
+
+// runCommitter is the SyncInterval background goroutine: it coalesces
+// concurrent appends by flushing and syncing once per tick (or early kick)
+// rather than once per Append, then wakes every AppendSync call whose
+// record is now durable.
+func (s *store) runCommitter() {
+	defer close(s.committerDone)
+	ticker := time.NewTicker(syncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stopCommitter:
+			s.commitOnce()
+			return
+		case <-ticker.C:
+			s.commitOnce()
+		case <-s.kick:
+			s.commitOnce()
+		}
+	}
+}
+
+// commitOnce flushes the buffered writer and fsyncs the file, then wakes
+// every pending AppendSync waiter whose record now falls within the
+// durable size.
+func (s *store) commitOnce() {
+	s.mu.Lock()
+	err := s.buf.Flush()
+	if err == nil {
+		err = s.File.Sync()
+	}
+	durable := s.size
+	s.bytesSinceCommit = 0
+	s.mu.Unlock()
+
+	s.waitersMu.Lock()
+	remaining := s.waiters[:0]
+	for _, w := range s.waiters {
+		if err != nil || w.pos <= durable {
+			w.done <- err
+		} else {
+			remaining = append(remaining, w)
+		}
+	}
+	s.waiters = remaining
+	s.waitersMu.Unlock()
+}
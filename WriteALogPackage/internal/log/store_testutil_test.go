@@ -0,0 +1,51 @@
+package log
+
+import (
+	"os"
+	"testing"
+)
+
+// newTestStore creates a *store backed by a temp file that's removed when
+// the test ends, applying any storeOptions a particular test needs (block
+// cache, sync policy, ...). It's the shared fixture for every test in this
+// package; add a storeOption rather than a new one-off constructor.
+func newTestStore(t *testing.T, opts ...storeOption) (*store, string) {
+	t.Helper()
+	f, err := os.CreateTemp("", "store_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := f.Name()
+	t.Cleanup(func() {
+		f.Close()
+		os.Remove(name)
+	})
+	s, err := newStore(f, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, name
+}
+
+// reopenTestStore closes s (flushing its buffered writer so every byte
+// Appended so far is actually on disk) and opens a fresh *store on the
+// same file. Tests that corrupt bytes via an independent *os.File handle
+// need this first: corrupting before a flush just gets silently
+// overwritten by the original, uncorrupted bytes the next time something
+// flushes the buffer.
+func reopenTestStore(t *testing.T, s *store, name string) *store {
+	t.Helper()
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	reopened, err := newStore(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reopened
+}